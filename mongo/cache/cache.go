@@ -0,0 +1,279 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/doubletrey/crawlab-db/mongo"
+	"github.com/doubletrey/crawlab-db/redis"
+	goredis "github.com/go-redis/redis/v8"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/sync/singleflight"
+)
+
+// MetricsHook is called once for each layer consulted during a cache
+// lookup ("lru", then "redis", then "mongo") with whether that layer had
+// the document, so callers can track hit/miss rates per layer. "mongo" is
+// reported only when the query returns the document.
+type MetricsHook func(layer string, hit bool)
+
+// CacheOptions configures the layered cache built by Cached.
+type CacheOptions struct {
+	// TTL is how long a document stays valid in the Redis (L2) layer.
+	// Defaults to 5 minutes.
+	TTL time.Duration
+	// MaxEntries bounds the in-process LRU (L1) by entry count. 0 means unbounded.
+	MaxEntries int
+	// MaxBytes bounds the in-process LRU (L1) by total encoded document size.
+	// 0 means unbounded.
+	MaxBytes int64
+	// Redis is the client backing the L2 layer and the cross-node
+	// invalidation pub/sub channel. Required.
+	Redis *redis.Redis
+	// Metrics, if set, is called on every cache lookup.
+	Metrics MetricsHook
+}
+
+func (o *CacheOptions) normalize() {
+	if o.TTL == 0 {
+		o.TTL = 5 * time.Minute
+	}
+}
+
+// cachedCol wraps a *mongo.Col with a read-through/write-invalidate cache:
+// L1 is a bounded in-process LRU, L2 is Redis holding BSON-encoded documents
+// keyed by "db:col:epoch:_id", and writes invalidate both locally and, via
+// Redis pub/sub, on every other process caching the same collection.
+//
+// It embeds mongo.ColInterface so methods it doesn't override (Insert,
+// indexes, ...) pass straight through to the underlying Col.
+type cachedCol struct {
+	mongo.ColInterface
+	col    *mongo.Col
+	opts   CacheOptions
+	lru    *lru
+	sf     singleflight.Group
+	pubsub *goredis.PubSub
+	ch     <-chan *goredis.Message
+	cancel context.CancelFunc
+	// epoch namespaces every L2 key. Bulk Update/Delete can't enumerate the
+	// ids they touched, so instead they bump this counter: every key from a
+	// prior epoch is simply never looked up again and ages out of Redis via
+	// its own TTL, giving O(1) bulk invalidation without leaving stale L2
+	// entries reachable.
+	epoch int64
+}
+
+// Closer is implemented by cache wrappers that hold background resources
+// (the invalidation subscription started by Cached) and must release them
+// explicitly once the caller is done with the collection.
+type Closer interface {
+	Close() error
+}
+
+// Cached wraps col with a layered cache as described in opts, returning a
+// mongo.ColInterface so existing call sites adopt caching without changing
+// call sites. opts.Redis is required. The returned value also implements
+// Closer; callers should Close it when done to stop the invalidation
+// subscription.
+func Cached(col *mongo.Col, opts CacheOptions) mongo.ColInterface {
+	opts.normalize()
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &cachedCol{
+		ColInterface: col,
+		col:          col,
+		opts:         opts,
+		lru:          newLRU(opts.MaxEntries, opts.MaxBytes),
+		cancel:       cancel,
+	}
+	if s, err := opts.Redis.GetCtx(ctx, c.epochKey()); err == nil {
+		if epoch, perr := strconv.ParseInt(s, 10, 64); perr == nil {
+			c.epoch = epoch
+		}
+	}
+	c.pubsub, c.ch = opts.Redis.Subscribe(ctx, c.invalidationChannel())
+	go c.watchInvalidations()
+	return c
+}
+
+func (c *cachedCol) cacheKey(id primitive.ObjectID) string {
+	return c.col.DatabaseName() + ":" + c.col.CollectionName() + ":" +
+		strconv.FormatInt(atomic.LoadInt64(&c.epoch), 10) + ":" + id.Hex()
+}
+
+func (c *cachedCol) epochKey() string {
+	return "cache:epoch:" + c.col.DatabaseName() + ":" + c.col.CollectionName()
+}
+
+func (c *cachedCol) invalidationChannel() string {
+	return "cache:invalidate:" + c.col.DatabaseName() + ":" + c.col.CollectionName()
+}
+
+// invalidateAllPrefix marks a published message as a new epoch number
+// (rather than a single cache key to delete) when a write can't be mapped
+// back to the specific ids it affects (e.g. a bulk Update/Delete by
+// filter), telling every subscriber to adopt it and drop their whole L1.
+const invalidateAllPrefix = "epoch:"
+
+func (c *cachedCol) watchInvalidations() {
+	for msg := range c.ch {
+		if strings.HasPrefix(msg.Payload, invalidateAllPrefix) {
+			epochStr := strings.TrimPrefix(msg.Payload, invalidateAllPrefix)
+			if epoch, err := strconv.ParseInt(epochStr, 10, 64); err == nil {
+				c.adoptEpoch(epoch)
+				c.lru.Clear()
+			}
+			continue
+		}
+		c.lru.Del(msg.Payload)
+	}
+}
+
+// adoptEpoch advances c.epoch to newEpoch, ignoring stale or duplicate
+// notifications that could otherwise arrive out of pub/sub delivery order.
+func (c *cachedCol) adoptEpoch(newEpoch int64) {
+	for {
+		cur := atomic.LoadInt64(&c.epoch)
+		if newEpoch <= cur {
+			return
+		}
+		if atomic.CompareAndSwapInt64(&c.epoch, cur, newEpoch) {
+			return
+		}
+	}
+}
+
+// Close stops the invalidation subscription and releases its pooled
+// connection. The cachedCol must not be used afterward.
+func (c *cachedCol) Close() error {
+	c.cancel()
+	return c.pubsub.Close()
+}
+
+func (c *cachedCol) reportMetric(layer string, hit bool) {
+	if c.opts.Metrics != nil {
+		c.opts.Metrics(layer, hit)
+	}
+}
+
+// FindId is read-through: L1 LRU, then Redis (L2), then Mongo. A miss on a
+// hot key fans concurrent callers through a singleflight.Group so only one
+// Mongo query is issued.
+func (c *cachedCol) FindId(id primitive.ObjectID) (fr *mongo.FindResult, err error) {
+	key := c.cacheKey(id)
+
+	if data, ok := c.lru.Get(key); ok {
+		c.reportMetric("lru", true)
+		return mongo.NewFindResultFromRaw(data), nil
+	}
+	c.reportMetric("lru", false)
+
+	data, err, _ := c.sf.Do(key, func() (interface{}, error) {
+		ctx := context.Background()
+		if s, rErr := c.opts.Redis.GetCtx(ctx, key); rErr == nil {
+			c.reportMetric("redis", true)
+			raw := []byte(s)
+			c.lru.Set(key, raw)
+			return raw, nil
+		}
+		c.reportMetric("redis", false)
+
+		mfr, mErr := c.col.FindId(id)
+		if mErr != nil {
+			return nil, mErr
+		}
+		var doc bson.Raw
+		if mErr = mfr.One(&doc); mErr != nil {
+			return nil, mErr
+		}
+		c.reportMetric("mongo", true)
+
+		_ = c.opts.Redis.SetCtx(ctx, key, []byte(doc), c.opts.TTL)
+		c.lru.Set(key, doc)
+		return []byte(doc), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return mongo.NewFindResultFromRaw(data.([]byte)), nil
+}
+
+// Find delegates to FindId's caching path for the common "find by _id"
+// query shape; any other query bypasses the cache entirely, since there is
+// no cheap way to know which ids a read-through cache keyed by _id should
+// invalidate for an arbitrary filter. A result taken from the cache path
+// supports One only; All on it returns errors.ErrNoCursor.
+func (c *cachedCol) Find(query bson.M, opts *mongo.FindOptions) (fr *mongo.FindResult, err error) {
+	if opts == nil && len(query) == 1 {
+		if idVal, ok := query["_id"]; ok {
+			if id, ok := idVal.(primitive.ObjectID); ok {
+				return c.FindId(id)
+			}
+		}
+	}
+	return c.col.Find(query, opts)
+}
+
+func (c *cachedCol) UpdateId(id primitive.ObjectID, update interface{}) (err error) {
+	if err = c.col.UpdateId(id, update); err != nil {
+		return err
+	}
+	c.invalidate(id)
+	return nil
+}
+
+func (c *cachedCol) DeleteId(id primitive.ObjectID) (err error) {
+	if err = c.col.DeleteId(id); err != nil {
+		return err
+	}
+	c.invalidate(id)
+	return nil
+}
+
+// Update runs a bulk update by filter. Unlike UpdateId, the affected ids
+// aren't known up front, so this flushes the whole L1/L2 cache for the
+// collection and tells other processes to do the same.
+func (c *cachedCol) Update(query bson.M, update interface{}) (err error) {
+	if err = c.col.Update(query, update); err != nil {
+		return err
+	}
+	c.invalidateAll()
+	return nil
+}
+
+// Delete runs a bulk delete by filter; see Update for why this flushes
+// rather than invalidating individual keys.
+func (c *cachedCol) Delete(query bson.M) (err error) {
+	if err = c.col.Delete(query); err != nil {
+		return err
+	}
+	c.invalidateAll()
+	return nil
+}
+
+func (c *cachedCol) invalidate(id primitive.ObjectID) {
+	key := c.cacheKey(id)
+	ctx := context.Background()
+	c.lru.Del(key)
+	_ = c.opts.Redis.DelCtx(ctx, key)
+	_ = c.opts.Redis.Publish(ctx, c.invalidationChannel(), key)
+}
+
+// invalidateAll bumps the collection's shared epoch in Redis so every
+// previously cached L2 key (keyed by the old epoch) is orphaned and left to
+// expire on its own TTL, then publishes the new epoch so every other
+// process watching this collection adopts it and drops its L1 too.
+func (c *cachedCol) invalidateAll() {
+	ctx := context.Background()
+	epoch, err := c.opts.Redis.IncrCtx(ctx, c.epochKey())
+	if err != nil {
+		return
+	}
+	c.adoptEpoch(epoch)
+	c.lru.Clear()
+	_ = c.opts.Redis.Publish(ctx, c.invalidationChannel(), invalidateAllPrefix+strconv.FormatInt(epoch, 10))
+}
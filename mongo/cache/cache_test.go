@@ -0,0 +1,25 @@
+package cache
+
+import "testing"
+
+func TestAdoptEpochOnlyMovesForward(t *testing.T) {
+	c := &cachedCol{epoch: 5}
+
+	c.adoptEpoch(3)
+	if c.epoch != 5 {
+		t.Fatalf("epoch = %d, want 5 (stale notification must be ignored)", c.epoch)
+	}
+
+	c.adoptEpoch(7)
+	if c.epoch != 7 {
+		t.Fatalf("epoch = %d, want 7", c.epoch)
+	}
+}
+
+func TestInvalidateAllPrefixRoundTrip(t *testing.T) {
+	const epoch = "42"
+	payload := invalidateAllPrefix + epoch
+	if got := payload[len(invalidateAllPrefix):]; got != epoch {
+		t.Fatalf("trimmed payload = %q, want %q", got, epoch)
+	}
+}
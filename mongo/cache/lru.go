@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+type lruEntry struct {
+	key   string
+	value []byte
+}
+
+// lru is a bounded, thread-safe, in-process cache of BSON-encoded documents.
+// It evicts by entry count and by total byte size, whichever limit is hit
+// first; a zero limit means that dimension is unbounded.
+type lru struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int64
+	curBytes   int64
+	ll         *list.List
+	items      map[string]*list.Element
+}
+
+func newLRU(maxEntries int, maxBytes int64) *lru {
+	return &lru{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+func (c *lru) Get(key string) (value []byte, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*lruEntry).value, true
+}
+
+func (c *lru) Set(key string, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		entry := el.Value.(*lruEntry)
+		c.curBytes += int64(len(value)) - int64(len(entry.value))
+		entry.value = value
+		c.ll.MoveToFront(el)
+	} else {
+		el := c.ll.PushFront(&lruEntry{key: key, value: value})
+		c.items[key] = el
+		c.curBytes += int64(len(value))
+	}
+	c.evict()
+}
+
+func (c *lru) Del(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+// Clear drops every cached entry, used when a bulk write can't be mapped
+// back to the specific ids it touched.
+func (c *lru) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+	c.curBytes = 0
+}
+
+func (c *lru) evict() {
+	for (c.maxEntries > 0 && c.ll.Len() > c.maxEntries) || (c.maxBytes > 0 && c.curBytes > c.maxBytes) {
+		el := c.ll.Back()
+		if el == nil {
+			return
+		}
+		c.removeElement(el)
+	}
+}
+
+func (c *lru) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	entry := el.Value.(*lruEntry)
+	delete(c.items, entry.key)
+	c.curBytes -= int64(len(entry.value))
+}
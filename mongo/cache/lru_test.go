@@ -0,0 +1,59 @@
+package cache
+
+import "testing"
+
+func TestLRUGetSetDel(t *testing.T) {
+	l := newLRU(0, 0)
+	if _, ok := l.Get("a"); ok {
+		t.Fatal("Get on empty lru should miss")
+	}
+	l.Set("a", []byte("1"))
+	if v, ok := l.Get("a"); !ok || string(v) != "1" {
+		t.Fatalf("Get(a) = %q, %v; want 1, true", v, ok)
+	}
+	l.Del("a")
+	if _, ok := l.Get("a"); ok {
+		t.Fatal("Get after Del should miss")
+	}
+}
+
+func TestLRUEvictsByMaxEntries(t *testing.T) {
+	l := newLRU(2, 0)
+	l.Set("a", []byte("1"))
+	l.Set("b", []byte("2"))
+	l.Set("c", []byte("3"))
+	if _, ok := l.Get("a"); ok {
+		t.Fatal("oldest entry should have been evicted once maxEntries was exceeded")
+	}
+	if _, ok := l.Get("b"); !ok {
+		t.Fatal("b should still be cached")
+	}
+	if _, ok := l.Get("c"); !ok {
+		t.Fatal("c should still be cached")
+	}
+}
+
+func TestLRUEvictsByMaxBytes(t *testing.T) {
+	l := newLRU(0, 1)
+	l.Set("a", []byte("1"))
+	l.Set("b", []byte("2"))
+	if _, ok := l.Get("a"); ok {
+		t.Fatal("a should have been evicted once curBytes exceeded maxBytes")
+	}
+}
+
+func TestLRUClear(t *testing.T) {
+	l := newLRU(0, 0)
+	l.Set("a", []byte("1"))
+	l.Set("b", []byte("2"))
+	l.Clear()
+	if _, ok := l.Get("a"); ok {
+		t.Fatal("Clear should have dropped a")
+	}
+	if _, ok := l.Get("b"); ok {
+		t.Fatal("Clear should have dropped b")
+	}
+	if l.ll.Len() != 0 || len(l.items) != 0 {
+		t.Fatal("Clear should reset internal bookkeeping")
+	}
+}
@@ -0,0 +1,42 @@
+package mongo
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ChangeStream wraps a *mongo.ChangeStream returned by Col.Watch, surfacing
+// a Next(ctx, &event) API and the stream's resume token so callers can
+// react to inserts/updates (e.g. pushing crawled-item events downstream).
+type ChangeStream struct {
+	col    *Col
+	stream *mongo.ChangeStream
+}
+
+// Next blocks until the next event is available, ctx is done, or the
+// stream is exhausted, decoding the event into event on success. ok is
+// false once there are no more events to wait for; callers should then
+// check Err to distinguish a clean close from a stream error.
+func (cs *ChangeStream) Next(ctx context.Context, event interface{}) (ok bool, err error) {
+	if !cs.stream.Next(ctx) {
+		return false, cs.stream.Err()
+	}
+	return true, cs.stream.Decode(event)
+}
+
+// ResumeToken returns the token for the most recently consumed event, for
+// callers that need to resume the stream later via options.ChangeStreamOptions.
+func (cs *ChangeStream) ResumeToken() bson.Raw {
+	return cs.stream.ResumeToken()
+}
+
+// Err returns any error that caused the stream to stop.
+func (cs *ChangeStream) Err() error {
+	return cs.stream.Err()
+}
+
+// Close terminates the change stream.
+func (cs *ChangeStream) Close(ctx context.Context) error {
+	return cs.stream.Close(ctx)
+}
@@ -21,6 +21,8 @@ type ColInterface interface {
 	Find(query bson.M, opts *FindOptions) (fr *FindResult, err error)
 	FindId(id primitive.ObjectID) (fr *FindResult, err error)
 	Count(query bson.M) (total int, err error)
+	Aggregate(pipeline mongo.Pipeline, opts *options.AggregateOptions) (fr *FindResult, err error)
+	Watch(pipeline mongo.Pipeline, opts *options.ChangeStreamOptions) (cs *ChangeStream, err error)
 	CreateIndex(indexModel mongo.IndexModel) (err error)
 	CreateIndexes(indexModels []mongo.IndexModel) (err error)
 	DeleteIndex(name string) (err error)
@@ -29,9 +31,11 @@ type ColInterface interface {
 }
 
 type FindOptions struct {
-	Skip  int
-	Limit int
-	Sort  bson.M
+	Skip       int
+	Limit      int
+	Sort       bson.M
+	Projection bson.M
+	Collation  *options.Collation
 }
 
 type Col struct {
@@ -115,11 +119,17 @@ func (col *Col) Find(query bson.M, opts *FindOptions) (fr *FindResult, err error
 		}
 		if opts.Limit != 0 {
 			limitInt64 := int64(opts.Limit)
-			_opts.Skip = &limitInt64
+			_opts.Limit = &limitInt64
 		}
 		if opts.Sort != nil {
 			_opts.Sort = opts.Sort
 		}
+		if opts.Projection != nil {
+			_opts.Projection = opts.Projection
+		}
+		if opts.Collation != nil {
+			_opts.Collation = opts.Collation
+		}
 	}
 	cur, err := col.c.Find(col.ctx, query, _opts)
 	if err != nil {
@@ -153,6 +163,31 @@ func (col *Col) Count(query bson.M) (total int, err error) {
 	return total, nil
 }
 
+// Aggregate runs an aggregation pipeline and returns it through the same
+// FindResult cursor plumbing as Find, so callers can .All(&out) the results.
+func (col *Col) Aggregate(pipeline mongo.Pipeline, opts *options.AggregateOptions) (fr *FindResult, err error) {
+	cur, err := col.c.Aggregate(col.ctx, pipeline, opts)
+	if err != nil {
+		return nil, err
+	}
+	fr = &FindResult{
+		col: col,
+		cur: cur,
+	}
+	return fr, nil
+}
+
+// Watch opens a change stream over the collection, wrapping the driver's
+// cursor so callers can poll it with Next instead of managing Decode
+// themselves.
+func (col *Col) Watch(pipeline mongo.Pipeline, opts *options.ChangeStreamOptions) (cs *ChangeStream, err error) {
+	stream, err := col.c.Watch(col.ctx, pipeline, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &ChangeStream{col: col, stream: stream}, nil
+}
+
 func (col *Col) CreateIndex(indexModel mongo.IndexModel) (err error) {
 	_, err = col.c.Indexes().CreateOne(col.ctx, indexModel)
 	if err != nil {
@@ -196,6 +231,25 @@ func (col *Col) ListIndexes() (indexes []map[string]interface{}, err error) {
 	return indexes, nil
 }
 
+// WithContext returns a shallow copy of col bound to ctx, so callers can
+// thread a session context (e.g. from DB.WithTransaction) through Col
+// operations for multi-collection atomic writes.
+func (col *Col) WithContext(ctx context.Context) *Col {
+	c := *col
+	c.ctx = ctx
+	return &c
+}
+
+// DatabaseName returns the name of the database this collection belongs to.
+func (col *Col) DatabaseName() string {
+	return col.db.Name()
+}
+
+// CollectionName returns the name of the underlying Mongo collection.
+func (col *Col) CollectionName() string {
+	return col.c.Name()
+}
+
 func GetMongoCol(colName string) (col *Col) {
 	return GetMongoColWithDb(colName, "")
 }
@@ -211,33 +265,3 @@ func GetMongoColWithDb(colName, dbName string) (col *Col) {
 	}
 	return col
 }
-
-//func GetDataSourceCol(host string, port string, username string, password string, authSource string, database string, col string) (*mgo.Session, *mgo.Collection, error) {
-//    timeout := time.Second * 10
-//    dialInfo := mgo.DialInfo{
-//        Addrs:         []string{net.JoinHostPort(host, port)},
-//        Timeout:       timeout,
-//        Database:      database,
-//        PoolLimit:     100,
-//        PoolTimeout:   timeout,
-//        ReadTimeout:   timeout,
-//        WriteTimeout:  timeout,
-//        AppName:       "crawlab",
-//        FailFast:      true,
-//        MinPoolSize:   10,
-//        MaxIdleTimeMS: 1000 * 30,
-//    }
-//    if username != "" {
-//        dialInfo.Username = username
-//        dialInfo.Password = password
-//        dialInfo.Source = authSource
-//    }
-//    s, err := mgo.DialWithInfo(&dialInfo)
-//    if err != nil {
-//        log.Errorf("dial mongo error: " + err.Error())
-//        debug.PrintStack()
-//        return nil, nil, err
-//    }
-//    db := s.DB(database)
-//    return s, db.C(col), nil
-//}
@@ -0,0 +1,237 @@
+package mongo
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/cenkalti/backoff/v4"
+	"github.com/crawlab-team/go-trace"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/sync/singleflight"
+)
+
+// DataSourceConfig describes an arbitrary, user-configured Mongo instance
+// (e.g. a crawler's output destination) rather than the viper-driven
+// singleton behind GetMongoDb.
+type DataSourceConfig struct {
+	// URI, if set, is used verbatim as the connection string (e.g. a full
+	// "mongodb+srv://..." URI) and Host, Port, Username, Password,
+	// AuthSource, ReplicaSet and SRV are ignored. Database and the TLS
+	// fields still apply.
+	URI string
+
+	Host       string
+	Port       string
+	Username   string
+	Password   string
+	AuthSource string
+	Database   string
+	ReplicaSet string
+	// SRV selects the "mongodb+srv://" scheme, which resolves Host via DNS
+	// SRV records and ignores Port.
+	SRV bool
+
+	TLS         bool
+	TLSCAFile   string
+	TLSCertFile string
+	TLSKeyFile  string
+}
+
+// dsn returns the canonical connection string for cfg, used both to dial
+// and as the DataSourceRegistry pooling key.
+func (cfg DataSourceConfig) dsn() string {
+	if cfg.URI != "" {
+		return cfg.URI
+	}
+
+	scheme := "mongodb"
+	host := cfg.Host
+	if cfg.SRV {
+		scheme = "mongodb+srv"
+	} else if cfg.Port != "" {
+		host = cfg.Host + ":" + cfg.Port
+	}
+
+	u := url.URL{
+		Scheme: scheme,
+		Host:   host,
+		Path:   "/" + cfg.Database,
+	}
+	if cfg.Username != "" {
+		u.User = url.UserPassword(cfg.Username, cfg.Password)
+	}
+
+	q := url.Values{}
+	if cfg.AuthSource != "" {
+		q.Set("authSource", cfg.AuthSource)
+	}
+	if cfg.ReplicaSet != "" {
+		q.Set("replicaSet", cfg.ReplicaSet)
+	}
+	if cfg.TLS {
+		q.Set("tls", "true")
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
+func (cfg DataSourceConfig) tlsConfig() (*tls.Config, error) {
+	if !cfg.TLS {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{}
+
+	if cfg.TLSCAFile != "" {
+		ca, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, trace.TraceError(err)
+		}
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(ca)
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, trace.TraceError(err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// NewDataSource dials an arbitrary Mongo instance described by cfg,
+// health-checking it with the same exponential-backoff retry pattern
+// InitRedis uses for the singleton Redis client, and returns it wrapped
+// in a *DB.
+func NewDataSource(cfg DataSourceConfig) (*DB, error) {
+	tlsConfig, err := cfg.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Client().ApplyURI(cfg.dsn())
+	if tlsConfig != nil {
+		opts.SetTLSConfig(tlsConfig)
+	}
+
+	client, err := mongo.Connect(context.Background(), opts)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	b := backoff.NewExponentialBackOff()
+	b.MaxInterval = 20 * time.Second
+	err = backoff.Retry(func() error {
+		err := client.Ping(context.Background(), nil)
+		if err != nil {
+			log.WithError(err).Warnf("waiting for mongo data source active connection. will after %f seconds try  again.", b.NextBackOff().Seconds())
+		}
+		return trace.TraceError(err)
+	}, b)
+	if err != nil {
+		return nil, err
+	}
+
+	dbName := cfg.Database
+	if dbName == "" {
+		dbName = "test"
+	}
+	return &DB{db: client.Database(dbName, nil), client: client}, nil
+}
+
+// Disconnect tears down the underlying client. It is a no-op for a DB
+// obtained from NewDB, which doesn't own a dedicated client.
+func (d *DB) Disconnect(ctx context.Context) error {
+	if d.client == nil {
+		return nil
+	}
+	return trace.TraceError(d.client.Disconnect(ctx))
+}
+
+type dataSourceEntry struct {
+	db       *DB
+	refCount int
+}
+
+// DataSourceRegistry pools *DB instances returned by NewDataSource, keyed
+// by their canonical DSN, so repeated Get calls for the same data source
+// reuse one underlying connection pool instead of dialing anew.
+type DataSourceRegistry struct {
+	mu      sync.Mutex
+	entries map[string]*dataSourceEntry
+	// dialing de-duplicates concurrent first Get calls for the same DSN and,
+	// crucially, is not held while mu is locked, so a slow or unreachable
+	// data source's dial+backoff only blocks callers waiting on that same
+	// DSN, not unrelated Gets/Closes on the registry.
+	dialing singleflight.Group
+}
+
+func NewDataSourceRegistry() *DataSourceRegistry {
+	return &DataSourceRegistry{entries: map[string]*dataSourceEntry{}}
+}
+
+// DefaultDataSourceRegistry is the process-wide registry most callers should use.
+var DefaultDataSourceRegistry = NewDataSourceRegistry()
+
+// Get returns the pooled DB for cfg's canonical DSN, dialing it on first
+// use, and increments its reference count. id identifies the pooled entry;
+// every Get must be paired with a Close(id) once the caller is done with it.
+// Dialing happens outside r.mu so a slow or unreachable data source can't
+// block Get/Close calls for other data sources.
+func (r *DataSourceRegistry) Get(cfg DataSourceConfig) (id string, db *DB, err error) {
+	id = cfg.dsn()
+
+	r.mu.Lock()
+	if entry, ok := r.entries[id]; ok {
+		entry.refCount++
+		r.mu.Unlock()
+		return id, entry.db, nil
+	}
+	r.mu.Unlock()
+
+	v, err, _ := r.dialing.Do(id, func() (interface{}, error) {
+		return NewDataSource(cfg)
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	db = v.(*DB)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if entry, ok := r.entries[id]; ok {
+		entry.refCount++
+		return id, entry.db, nil
+	}
+	r.entries[id] = &dataSourceEntry{db: db, refCount: 1}
+	return id, db, nil
+}
+
+// Close decrements id's reference count and disconnects the underlying
+// client once no callers are left holding it.
+func (r *DataSourceRegistry) Close(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.entries[id]
+	if !ok {
+		return nil
+	}
+	entry.refCount--
+	if entry.refCount > 0 {
+		return nil
+	}
+	delete(r.entries, id)
+	return entry.db.Disconnect(context.Background())
+}
@@ -1,6 +1,7 @@
 package mongo
 
 import (
+	"context"
 	"github.com/spf13/viper"
 	"go.mongodb.org/mongo-driver/mongo"
 )
@@ -11,3 +12,51 @@ func GetMongoDb(dbName string) (db *mongo.Database) {
 	}
 	return Client.Database(dbName, nil)
 }
+
+// DB wraps a *mongo.Database to add session/transaction support that spans
+// multiple collections, which Col (scoped to a single collection) can't
+// express on its own.
+type DB struct {
+	db *mongo.Database
+	// client is set only for DBs returned by NewDataSource, which own a
+	// dedicated *mongo.Client rather than sharing the package-level Client.
+	client *mongo.Client
+}
+
+// NewDB returns a DB for dbName, or the viper-configured "mongo.db" if dbName is empty.
+func NewDB(dbName string) *DB {
+	return &DB{db: GetMongoDb(dbName)}
+}
+
+// Col returns a Col bound to this database's collection named colName.
+func (d *DB) Col(colName string) *Col {
+	return &Col{
+		ctx: context.Background(),
+		db:  d.db,
+		c:   d.db.Collection(colName),
+	}
+}
+
+// WithTransaction runs fn inside a session transaction, committing if fn
+// returns nil and aborting otherwise. fn receives a mongo.SessionContext
+// that callers must pass to Col.WithContext so their collection operations
+// participate in the transaction. The session is started on d's own client
+// when set (DBs from NewDataSource), falling back to the package-level
+// Client otherwise, so a transaction on a data-source DB never runs
+// against the wrong Mongo deployment.
+func (d *DB) WithTransaction(ctx context.Context, fn func(sc mongo.SessionContext) error) error {
+	client := d.client
+	if client == nil {
+		client = Client
+	}
+	sess, err := client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer sess.EndSession(ctx)
+
+	_, err = sess.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
@@ -3,6 +3,7 @@ package mongo
 import (
 	"context"
 	"github.com/doubletrey/crawlab-db/errors"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
@@ -21,10 +22,19 @@ func NewFindResultWithError(err error) (fr *FindResult) {
 	}
 }
 
+// NewFindResultFromRaw builds a FindResult that decodes straight from an
+// already-fetched BSON document instead of a cursor or single result, so
+// callers such as a read-through cache can return the same FindResult type
+// for documents that never touched Mongo on this call.
+func NewFindResultFromRaw(doc bson.Raw) (fr *FindResult) {
+	return &FindResult{doc: doc}
+}
+
 type FindResult struct {
 	col *Col
 	res *mongo.SingleResult
 	cur *mongo.Cursor
+	doc bson.Raw
 	err error
 }
 
@@ -32,6 +42,9 @@ func (fr *FindResult) One(val interface{}) (err error) {
 	if fr.err != nil {
 		return fr.err
 	}
+	if fr.doc != nil {
+		return bson.Unmarshal(fr.doc, val)
+	}
 	if fr.cur != nil {
 		if !fr.cur.TryNext(fr.col.ctx) {
 			return mongo.ErrNoDocuments
@@ -0,0 +1,230 @@
+package redis
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/cenkalti/backoff/v4"
+	"github.com/crawlab-team/go-trace"
+	"golang.org/x/sync/singleflight"
+)
+
+// DataSourceConfig describes an arbitrary, user-configured Redis instance
+// (e.g. a crawler's output destination) rather than the viper-driven
+// singleton behind NewRedisClient.
+type DataSourceConfig struct {
+	Mode Mode
+
+	Address    string
+	Port       string
+	Addresses  []string
+	MasterName string
+	Password   string
+	Database   int
+
+	TLS         bool
+	TLSCAFile   string
+	TLSCertFile string
+	TLSKeyFile  string
+}
+
+// dsn returns the canonical connection string for cfg, used as the
+// DataSourceRegistry pooling key. It includes Password and the TLS material
+// (not just mode/addresses/database) so two tenants pointed at the same
+// Redis host with different credentials don't collide on the same pooled
+// connection.
+func (cfg DataSourceConfig) dsn() string {
+	addresses := cfg.addresses()
+	dsn := string(cfg.Mode) + "://"
+	for i, addr := range addresses {
+		if i > 0 {
+			dsn += ","
+		}
+		dsn += addr
+	}
+	dsn += "/" + strconv.Itoa(cfg.Database)
+
+	q := url.Values{}
+	if cfg.MasterName != "" {
+		q.Set("masterName", cfg.MasterName)
+	}
+	if cfg.Password != "" {
+		q.Set("password", cfg.Password)
+	}
+	if cfg.TLS {
+		q.Set("tls", "true")
+		q.Set("tlsCAFile", cfg.TLSCAFile)
+		q.Set("tlsCertFile", cfg.TLSCertFile)
+		q.Set("tlsKeyFile", cfg.TLSKeyFile)
+	}
+	if encoded := q.Encode(); encoded != "" {
+		dsn += "?" + encoded
+	}
+	return dsn
+}
+
+func (cfg DataSourceConfig) addresses() []string {
+	if len(cfg.Addresses) > 0 {
+		return cfg.Addresses
+	}
+	address := cfg.Address
+	if address == "" {
+		address = "localhost"
+	}
+	port := cfg.Port
+	if port == "" {
+		port = "6379"
+	}
+	return []string{address + ":" + port}
+}
+
+func (cfg DataSourceConfig) tlsConfig() (*tls.Config, error) {
+	if !cfg.TLS {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{}
+
+	if cfg.TLSCAFile != "" {
+		ca, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, trace.TraceError(err)
+		}
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(ca)
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, trace.TraceError(err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// NewDataSource dials an arbitrary Redis instance described by cfg,
+// health-checking it with the same exponential backoff InitRedis uses for
+// the singleton.
+func NewDataSource(cfg DataSourceConfig) (*Redis, error) {
+	tlsConfig, err := cfg.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	client := buildUniversalClient(universalClientConfig{
+		mode:       cfg.Mode,
+		addresses:  cfg.addresses(),
+		masterName: cfg.MasterName,
+		password:   cfg.Password,
+		database:   cfg.Database,
+		tlsConfig:  tlsConfig,
+	})
+	r := &Redis{client: client}
+
+	b := backoff.NewExponentialBackOff()
+	b.MaxInterval = 20 * time.Second
+	err = backoff.Retry(func() error {
+		err := r.PingCtx(context.Background())
+		if err != nil {
+			log.WithError(err).Warnf("waiting for redis data source active connection. will after %f seconds try  again.", b.NextBackOff().Seconds())
+		}
+		return trace.TraceError(err)
+	}, b)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Close closes the underlying client's connections.
+func (r *Redis) Close() error {
+	return trace.TraceError(r.client.Close())
+}
+
+type dataSourceEntry struct {
+	redis    *Redis
+	refCount int
+}
+
+// DataSourceRegistry pools *Redis instances returned by NewDataSource,
+// keyed by their canonical DSN, so repeated Get calls for the same data
+// source reuse one underlying connection pool instead of dialing anew.
+type DataSourceRegistry struct {
+	mu      sync.Mutex
+	entries map[string]*dataSourceEntry
+	// dialing de-duplicates concurrent first Get calls for the same DSN and,
+	// crucially, is not held while mu is locked, so a slow or unreachable
+	// data source's dial+backoff only blocks callers waiting on that same
+	// DSN, not unrelated Gets/Closes on the registry.
+	dialing singleflight.Group
+}
+
+func NewDataSourceRegistry() *DataSourceRegistry {
+	return &DataSourceRegistry{entries: map[string]*dataSourceEntry{}}
+}
+
+// DefaultDataSourceRegistry is the process-wide registry most callers should use.
+var DefaultDataSourceRegistry = NewDataSourceRegistry()
+
+// Get returns the pooled Redis client for cfg's canonical DSN, dialing it
+// on first use, and increments its reference count. id identifies the
+// pooled entry; every Get must be paired with a Close(id) once the caller
+// is done with it. Dialing happens outside r.mu so a slow or unreachable
+// data source can't block Get/Close calls for other data sources.
+func (r *DataSourceRegistry) Get(cfg DataSourceConfig) (id string, client *Redis, err error) {
+	id = cfg.dsn()
+
+	r.mu.Lock()
+	if entry, ok := r.entries[id]; ok {
+		entry.refCount++
+		r.mu.Unlock()
+		return id, entry.redis, nil
+	}
+	r.mu.Unlock()
+
+	v, err, _ := r.dialing.Do(id, func() (interface{}, error) {
+		return NewDataSource(cfg)
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	client = v.(*Redis)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if entry, ok := r.entries[id]; ok {
+		entry.refCount++
+		return id, entry.redis, nil
+	}
+	r.entries[id] = &dataSourceEntry{redis: client, refCount: 1}
+	return id, client, nil
+}
+
+// Close decrements id's reference count and closes the underlying client
+// once no callers are left holding it.
+func (r *DataSourceRegistry) Close(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.entries[id]
+	if !ok {
+		return nil
+	}
+	entry.refCount--
+	if entry.refCount > 0 {
+		return nil
+	}
+	delete(r.entries, id)
+	return entry.redis.Close()
+}
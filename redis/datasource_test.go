@@ -0,0 +1,37 @@
+package redis
+
+import "testing"
+
+func TestDataSourceConfigDSNIncludesCredentials(t *testing.T) {
+	base := DataSourceConfig{Address: "localhost", Port: "6379", Database: 0}
+	withPassword := base
+	withPassword.Password = "s3cret"
+
+	if base.dsn() == withPassword.dsn() {
+		t.Fatal("dsn() must differ when Password differs, or two tenants on the same host:port:db collide on one pooled connection")
+	}
+}
+
+func TestDataSourceConfigDSNIncludesTLS(t *testing.T) {
+	base := DataSourceConfig{Address: "localhost", Port: "6379"}
+	withTLS := base
+	withTLS.TLS = true
+	withTLS.TLSCertFile = "/etc/certs/a.pem"
+
+	if base.dsn() == withTLS.dsn() {
+		t.Fatal("dsn() must differ when TLS material differs")
+	}
+
+	otherCert := withTLS
+	otherCert.TLSCertFile = "/etc/certs/b.pem"
+	if withTLS.dsn() == otherCert.dsn() {
+		t.Fatal("dsn() must differ when TLSCertFile differs")
+	}
+}
+
+func TestDataSourceConfigDSNDeterministic(t *testing.T) {
+	cfg := DataSourceConfig{Address: "localhost", Port: "6379", Database: 1, Password: "p"}
+	if cfg.dsn() != cfg.dsn() {
+		t.Fatal("dsn() must be deterministic for the same config")
+	}
+}
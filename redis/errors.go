@@ -0,0 +1,20 @@
+package redis
+
+import "errors"
+
+// These are sentinel errors specific to this package's higher-level
+// primitives (Mutex, Queue); they aren't part of the shared
+// crawlab-team/crawlab-db/errors package, which only covers the low-level
+// client errors (ErrAlreadyLocked, ErrNoCursor, ...).
+var (
+	// ErrLockNotHeld is returned by Mutex.Extend/Unlock when the mutex's
+	// token no longer matches the lock, e.g. because its TTL expired and
+	// another caller acquired it first.
+	ErrLockNotHeld = errors.New("redis: lock not held")
+	// ErrLockAcquireTimeout is returned by Mutex.Lock when the lock is
+	// still held by someone else after all retries are exhausted.
+	ErrLockAcquireTimeout = errors.New("redis: lock acquire timeout")
+	// ErrQueueEmpty is returned by Queue.Reserve when no job became
+	// available before the reserve timeout elapsed.
+	ErrQueueEmpty = errors.New("redis: queue empty")
+)
@@ -0,0 +1,236 @@
+package redis
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"encoding/hex"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crawlab-team/go-trace"
+	goredis "github.com/go-redis/redis/v8"
+)
+
+// releaseScript atomically checks the lock token before deleting it, so a
+// caller can never release a lock it does not hold (e.g. after its TTL
+// expired and another caller re-acquired the same key).
+var releaseScript = goredis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+else
+	return 0
+end
+`)
+
+// extendScript atomically checks the lock token before renewing its TTL.
+var extendScript = goredis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+else
+	return 0
+end
+`)
+
+// MutexOptions configures a Mutex returned by Redis.NewMutex.
+type MutexOptions struct {
+	// Expiry is the lock's TTL. Defaults to 30s.
+	Expiry time.Duration
+	// Tries is the number of acquisition attempts Lock makes before giving
+	// up. Defaults to 32.
+	Tries int
+	// Delay is the base delay between acquisition attempts; each wait adds
+	// a random jitter of up to Delay on top of it. Defaults to 500ms.
+	Delay time.Duration
+	// DriftFactor accounts for clock drift by lengthening the TTL that
+	// Extend sets by this fraction of Expiry. The initial SET in TryLock
+	// uses Expiry unchanged. Defaults to 0.01.
+	DriftFactor float64
+}
+
+// Mutex is a Redlock-style distributed lock: the holder is identified by a
+// random token rather than a timestamp, and release/renewal are atomic
+// compare-and-act Lua scripts, so a caller can never affect a lock it does
+// not hold.
+type Mutex struct {
+	Name string
+
+	redis       *Redis
+	expiry      time.Duration
+	tries       int
+	delay       time.Duration
+	driftFactor float64
+
+	mu          sync.Mutex
+	value       string
+	cancelRenew context.CancelFunc
+}
+
+// NewMutex returns a Mutex for the given name. opts may be nil to accept
+// all defaults.
+func (r *Redis) NewMutex(name string, opts *MutexOptions) *Mutex {
+	if opts == nil {
+		opts = &MutexOptions{}
+	}
+	expiry := opts.Expiry
+	if expiry == 0 {
+		expiry = 30 * time.Second
+	}
+	tries := opts.Tries
+	if tries == 0 {
+		tries = 32
+	}
+	delay := opts.Delay
+	if delay == 0 {
+		delay = 500 * time.Millisecond
+	}
+	driftFactor := opts.DriftFactor
+	if driftFactor == 0 {
+		driftFactor = 0.01
+	}
+	return &Mutex{
+		Name:        name,
+		redis:       r,
+		expiry:      expiry,
+		tries:       tries,
+		delay:       delay,
+		driftFactor: driftFactor,
+	}
+}
+
+func (m *Mutex) key() string {
+	return "nodes:lock:" + strings.ReplaceAll(m.Name, ":", "-")
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := cryptorand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// TryLock makes a single, non-blocking acquisition attempt and starts a
+// background goroutine that renews the TTL at expiry/3 intervals until
+// Unlock is called or ctx is done.
+func (m *Mutex) TryLock(ctx context.Context) (bool, error) {
+	token, err := newToken()
+	if err != nil {
+		return false, trace.TraceError(err)
+	}
+
+	ok, err := m.redis.client.SetNX(ctx, m.key(), token, m.expiry).Result()
+	if err != nil {
+		return false, trace.TraceError(err)
+	}
+	if !ok {
+		return false, nil
+	}
+
+	m.mu.Lock()
+	m.value = token
+	renewCtx, cancel := context.WithCancel(ctx)
+	m.cancelRenew = cancel
+	m.mu.Unlock()
+	go m.autoRenew(renewCtx)
+
+	return true, nil
+}
+
+// Lock retries acquisition up to m.tries times, sleeping m.delay (plus
+// jitter) between attempts, and returns ErrLockAcquireTimeout if the lock
+// is still held by someone else after the last attempt.
+func (m *Mutex) Lock(ctx context.Context) error {
+	for i := 0; i < m.tries; i++ {
+		ok, err := m.TryLock(ctx)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		if i == m.tries-1 {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return trace.TraceError(ctx.Err())
+		case <-time.After(m.delay + jitter(m.delay)):
+		}
+	}
+	return trace.TraceError(ErrLockAcquireTimeout)
+}
+
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d)))
+}
+
+// Extend renews the lock's TTL, accounting for clock drift, as long as it
+// is still held by this Mutex's token.
+func (m *Mutex) Extend(ctx context.Context) error {
+	m.mu.Lock()
+	token := m.value
+	m.mu.Unlock()
+	if token == "" {
+		return trace.TraceError(ErrLockNotHeld)
+	}
+
+	ttl := m.expiry.Milliseconds() + int64(float64(m.expiry.Milliseconds())*m.driftFactor)
+	res, err := extendScript.Run(ctx, m.redis.client, []string{m.key()}, token, ttl).Result()
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	if n, _ := res.(int64); n == 0 {
+		return trace.TraceError(ErrLockNotHeld)
+	}
+	return nil
+}
+
+func (m *Mutex) autoRenew(ctx context.Context) {
+	interval := m.expiry / 3
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_ = m.Extend(ctx)
+		}
+	}
+}
+
+// Unlock releases the lock if it is still held by this Mutex's token, and
+// stops the background renewal goroutine started by Lock/TryLock.
+func (m *Mutex) Unlock(ctx context.Context) error {
+	m.mu.Lock()
+	token := m.value
+	cancel := m.cancelRenew
+	m.value = ""
+	m.cancelRenew = nil
+	m.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	if token == "" {
+		return trace.TraceError(ErrLockNotHeld)
+	}
+
+	res, err := releaseScript.Run(ctx, m.redis.client, []string{m.key()}, token).Result()
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	if n, _ := res.(int64); n == 0 {
+		return trace.TraceError(ErrLockNotHeld)
+	}
+	return nil
+}
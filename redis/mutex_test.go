@@ -0,0 +1,66 @@
+package redis
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewToken(t *testing.T) {
+	a, err := newToken()
+	if err != nil {
+		t.Fatalf("newToken: %v", err)
+	}
+	b, err := newToken()
+	if err != nil {
+		t.Fatalf("newToken: %v", err)
+	}
+	if a == b {
+		t.Fatalf("newToken returned the same value twice: %q", a)
+	}
+	if len(a) != 32 {
+		t.Fatalf("newToken length = %d, want 32 (16 bytes hex-encoded)", len(a))
+	}
+}
+
+func TestMutexKey(t *testing.T) {
+	m := &Mutex{Name: "crawler:job:123"}
+	got := m.key()
+	want := "nodes:lock:crawler-job-123"
+	if got != want {
+		t.Fatalf("key() = %q, want %q", got, want)
+	}
+	if strings.Contains(got, ":lock:"+m.Name) {
+		t.Fatalf("key() did not sanitize colons in Name: %q", got)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	if got := jitter(0); got != 0 {
+		t.Fatalf("jitter(0) = %v, want 0", got)
+	}
+	d := 500 * time.Millisecond
+	for i := 0; i < 100; i++ {
+		got := jitter(d)
+		if got < 0 || got >= d {
+			t.Fatalf("jitter(%v) = %v, want in [0, %v)", d, got, d)
+		}
+	}
+}
+
+func TestNewMutexDefaults(t *testing.T) {
+	r := &Redis{}
+	m := r.NewMutex("test", nil)
+	if m.expiry != 30*time.Second {
+		t.Errorf("expiry = %v, want 30s", m.expiry)
+	}
+	if m.tries != 32 {
+		t.Errorf("tries = %d, want 32", m.tries)
+	}
+	if m.delay != 500*time.Millisecond {
+		t.Errorf("delay = %v, want 500ms", m.delay)
+	}
+	if m.driftFactor != 0.01 {
+		t.Errorf("driftFactor = %v, want 0.01", m.driftFactor)
+	}
+}
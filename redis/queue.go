@@ -0,0 +1,279 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/crawlab-team/go-trace"
+	goredis "github.com/go-redis/redis/v8"
+)
+
+// Job is the envelope carried through a Queue: enqueued as JSON, reserved
+// by a consumer, then Ack'd, Nack'd (retried or dead-lettered), or
+// recovered if the consumer that reserved it disappears.
+type Job struct {
+	ID          string `json:"id"`
+	Payload     string `json:"payload"`
+	EnqueuedAt  int64  `json:"enqueuedAt"`
+	Attempts    int    `json:"attempts"`
+	MaxAttempts int    `json:"maxAttempts"`
+
+	raw string
+}
+
+// QueueOptions configures a Queue returned by Redis.NewQueue.
+type QueueOptions struct {
+	// MaxAttempts caps how many times a job may be Nacked before it is
+	// routed to the dead-letter list. Defaults to 5.
+	MaxAttempts int
+	// ConsumerID identifies this process's processing list and heartbeat
+	// key. Defaults to a random token.
+	ConsumerID string
+	// HeartbeatTTL is how long a consumer's liveness marker stays valid
+	// between Reserve/Heartbeat calls before Recover treats it as dead.
+	// Defaults to 30s.
+	HeartbeatTTL time.Duration
+}
+
+// Queue provides reliable work-queue primitives on top of Redis lists:
+// Enqueue/Reserve/Ack/Nack/Recover, modeled on BRPOPLPUSH-based patterns
+// (e.g. Sidekiq/RQ's "reliable queue") so a consumer that crashes between
+// Reserve and Ack never silently loses the job.
+type Queue struct {
+	redis        *Redis
+	name         string
+	consumerID   string
+	maxAttempts  int
+	heartbeatTTL time.Duration
+}
+
+// NewQueue returns a Queue named name. opts may be nil to accept all defaults.
+func (r *Redis) NewQueue(name string, opts *QueueOptions) *Queue {
+	if opts == nil {
+		opts = &QueueOptions{}
+	}
+	maxAttempts := opts.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = 5
+	}
+	consumerID := opts.ConsumerID
+	if consumerID == "" {
+		consumerID, _ = newToken()
+	}
+	heartbeatTTL := opts.HeartbeatTTL
+	if heartbeatTTL == 0 {
+		heartbeatTTL = 30 * time.Second
+	}
+	return &Queue{
+		redis:        r,
+		name:         name,
+		consumerID:   consumerID,
+		maxAttempts:  maxAttempts,
+		heartbeatTTL: heartbeatTTL,
+	}
+}
+
+func (q *Queue) mainKey() string      { return "queue:" + q.name }
+func (q *Queue) delayedKey() string   { return "queue:" + q.name + ":delayed" }
+func (q *Queue) deadKey() string      { return "queue:" + q.name + ":dead" }
+func (q *Queue) consumersKey() string { return "queue:" + q.name + ":consumers" }
+
+func (q *Queue) processingKey(consumerID string) string {
+	return "queue:" + q.name + ":processing:" + consumerID
+}
+
+func (q *Queue) heartbeatKey(consumerID string) string {
+	return "queue:" + q.name + ":heartbeat:" + consumerID
+}
+
+// Enqueue pushes a new job carrying payload onto the queue. Jobs are
+// pushed onto the head so that Reserve, which pops from the tail, serves
+// them in FIFO order.
+func (q *Queue) Enqueue(ctx context.Context, payload string) (Job, error) {
+	id, err := newToken()
+	if err != nil {
+		return Job{}, trace.TraceError(err)
+	}
+	job := Job{
+		ID:          id,
+		Payload:     payload,
+		EnqueuedAt:  time.Now().Unix(),
+		MaxAttempts: q.maxAttempts,
+	}
+	data, err := json.Marshal(job)
+	if err != nil {
+		return Job{}, trace.TraceError(err)
+	}
+	if err := q.redis.client.LPush(ctx, q.mainKey(), data).Err(); err != nil {
+		return Job{}, trace.TraceError(err)
+	}
+	job.raw = string(data)
+	return job, nil
+}
+
+// Reserve blocks up to timeout for a job, atomically moving it from the
+// tail of the main list (the oldest job, since Enqueue pushes onto the
+// head) onto this consumer's processing list (BRPOPLPUSH; equivalent to
+// BLMOVE src dst RIGHT LEFT timeout on Redis >= 6.2), and refreshes this
+// consumer's heartbeat so Recover knows it is alive.
+func (q *Queue) Reserve(ctx context.Context, timeout time.Duration) (Job, error) {
+	if err := q.Heartbeat(ctx); err != nil {
+		return Job{}, err
+	}
+
+	data, err := q.redis.client.BRPopLPush(ctx, q.mainKey(), q.processingKey(q.consumerID), timeout).Result()
+	if err != nil {
+		if err == goredis.Nil {
+			return Job{}, trace.TraceError(ErrQueueEmpty)
+		}
+		return Job{}, trace.TraceError(err)
+	}
+
+	var job Job
+	if err := json.Unmarshal([]byte(data), &job); err != nil {
+		return Job{}, trace.TraceError(err)
+	}
+	job.raw = data
+	return job, nil
+}
+
+// Heartbeat refreshes this consumer's liveness marker. Reserve calls it
+// automatically; callers processing long-running jobs should also call it
+// periodically between Reserve and Ack so Recover doesn't treat them as dead.
+func (q *Queue) Heartbeat(ctx context.Context) error {
+	if err := q.redis.client.SAdd(ctx, q.consumersKey(), q.consumerID).Err(); err != nil {
+		return trace.TraceError(err)
+	}
+	return q.redis.SetCtx(ctx, q.heartbeatKey(q.consumerID), time.Now().Unix(), q.heartbeatTTL)
+}
+
+// Ack removes a successfully processed job from this consumer's processing list.
+func (q *Queue) Ack(ctx context.Context, job Job) error {
+	if err := q.redis.client.LRem(ctx, q.processingKey(q.consumerID), 1, job.raw).Err(); err != nil {
+		return trace.TraceError(err)
+	}
+	return nil
+}
+
+// Nack removes job from this consumer's processing list and, if it still
+// has attempts remaining, schedules a retry after retryDelay; otherwise it
+// routes the job to the dead-letter list.
+func (q *Queue) Nack(ctx context.Context, job Job, retryDelay time.Duration) error {
+	if err := q.redis.client.LRem(ctx, q.processingKey(q.consumerID), 1, job.raw).Err(); err != nil {
+		return trace.TraceError(err)
+	}
+
+	job.Attempts++
+	if job.MaxAttempts == 0 {
+		job.MaxAttempts = q.maxAttempts
+	}
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		return trace.TraceError(err)
+	}
+
+	if job.Attempts >= job.MaxAttempts {
+		if err := q.redis.client.RPush(ctx, q.deadKey(), data).Err(); err != nil {
+			return trace.TraceError(err)
+		}
+		return nil
+	}
+
+	readyAt := float64(time.Now().Add(retryDelay).UnixNano())
+	if err := q.redis.client.ZAdd(ctx, q.delayedKey(), &goredis.Z{Score: readyAt, Member: data}).Err(); err != nil {
+		return trace.TraceError(err)
+	}
+	return nil
+}
+
+// PromoteDue moves delayed jobs whose retry time has passed back onto the
+// main list and returns how many were promoted. Call it periodically (e.g.
+// from a background goroutine shared across consumers) to drive scheduled
+// retries.
+func (q *Queue) PromoteDue(ctx context.Context) (int, error) {
+	now := strconv.FormatFloat(float64(time.Now().UnixNano()), 'f', 0, 64)
+	members, err := q.redis.client.ZRangeByScore(ctx, q.delayedKey(), &goredis.ZRangeBy{
+		Min: "-inf",
+		Max: now,
+	}).Result()
+	if err != nil {
+		return 0, trace.TraceError(err)
+	}
+
+	for _, m := range members {
+		if err := q.redis.client.ZRem(ctx, q.delayedKey(), m).Err(); err != nil {
+			return 0, trace.TraceError(err)
+		}
+		if err := q.redis.client.LPush(ctx, q.mainKey(), m).Err(); err != nil {
+			return 0, trace.TraceError(err)
+		}
+	}
+	return len(members), nil
+}
+
+// Recover requeues the contents of every processing list whose consumer
+// heartbeat has expired (or was last seen more than olderThan ago, as a
+// defensive check in case the heartbeat key itself failed to expire),
+// returning how many jobs were requeued.
+func (q *Queue) Recover(ctx context.Context, olderThan time.Duration) (int, error) {
+	consumerIDs, err := q.redis.client.SMembers(ctx, q.consumersKey()).Result()
+	if err != nil {
+		return 0, trace.TraceError(err)
+	}
+
+	var recovered int
+	for _, consumerID := range consumerIDs {
+		stale, err := q.isStale(ctx, consumerID, olderThan)
+		if err != nil {
+			return recovered, err
+		}
+		if !stale {
+			continue
+		}
+
+		n, err := q.drainProcessing(ctx, consumerID)
+		if err != nil {
+			return recovered, err
+		}
+		recovered += n
+
+		if err := q.redis.client.SRem(ctx, q.consumersKey(), consumerID).Err(); err != nil {
+			return recovered, trace.TraceError(err)
+		}
+	}
+	return recovered, nil
+}
+
+func (q *Queue) isStale(ctx context.Context, consumerID string, olderThan time.Duration) (bool, error) {
+	s, err := q.redis.GetCtx(ctx, q.heartbeatKey(consumerID))
+	if err != nil {
+		if err == goredis.Nil {
+			return true, nil
+		}
+		return false, err
+	}
+	seenUnix, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return false, trace.TraceError(err)
+	}
+	return time.Since(time.Unix(seenUnix, 0)) > olderThan, nil
+}
+
+func (q *Queue) drainProcessing(ctx context.Context, consumerID string) (int, error) {
+	key := q.processingKey(consumerID)
+	var n int
+	for {
+		_, err := q.redis.client.RPopLPush(ctx, key, q.mainKey()).Result()
+		if err == goredis.Nil {
+			break
+		}
+		if err != nil {
+			return n, trace.TraceError(err)
+		}
+		n++
+	}
+	return n, nil
+}
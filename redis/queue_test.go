@@ -0,0 +1,39 @@
+package redis
+
+import "testing"
+
+func TestQueueKeys(t *testing.T) {
+	q := &Queue{name: "crawl-tasks"}
+
+	cases := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"mainKey", q.mainKey(), "queue:crawl-tasks"},
+		{"delayedKey", q.delayedKey(), "queue:crawl-tasks:delayed"},
+		{"deadKey", q.deadKey(), "queue:crawl-tasks:dead"},
+		{"consumersKey", q.consumersKey(), "queue:crawl-tasks:consumers"},
+		{"processingKey", q.processingKey("c1"), "queue:crawl-tasks:processing:c1"},
+		{"heartbeatKey", q.heartbeatKey("c1"), "queue:crawl-tasks:heartbeat:c1"},
+	}
+	for _, c := range cases {
+		if c.got != c.want {
+			t.Errorf("%s = %q, want %q", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestNewQueueDefaults(t *testing.T) {
+	r := &Redis{}
+	q := r.NewQueue("crawl-tasks", nil)
+	if q.maxAttempts != 5 {
+		t.Errorf("maxAttempts = %d, want 5", q.maxAttempts)
+	}
+	if q.consumerID == "" {
+		t.Error("consumerID should default to a random token, got empty string")
+	}
+	if q.heartbeatTTL.Seconds() != 30 {
+		t.Errorf("heartbeatTTL = %v, want 30s", q.heartbeatTTL)
+	}
+}
@@ -1,16 +1,16 @@
 package redis
 
 import (
+	"context"
+	"crypto/tls"
+	"time"
+
 	"github.com/apex/log"
 	"github.com/cenkalti/backoff/v4"
-	"github.com/crawlab-team/crawlab-db/errors"
 	"github.com/crawlab-team/crawlab-db/utils"
 	"github.com/crawlab-team/go-trace"
-	"github.com/gomodule/redigo/redis"
+	goredis "github.com/go-redis/redis/v8"
 	"github.com/spf13/viper"
-	"reflect"
-	"strings"
-	"time"
 )
 
 var RedisClient *Redis
@@ -24,59 +24,164 @@ var MemoryStatsMetrics = []string{
 	"dataset.bytes",
 }
 
+// Mode is the deployment topology of the backing Redis server(s), selected
+// via the "redis.mode" viper config: single, cluster, or sentinel.
+type Mode string
+
+const (
+	ModeSingle   Mode = "single"
+	ModeCluster  Mode = "cluster"
+	ModeSentinel Mode = "sentinel"
+)
+
 type Redis struct {
-	pool *redis.Pool
+	client goredis.UniversalClient
 }
 
-type Mutex struct {
-	Name   string
-	expiry time.Duration
-	tries  int
-	delay  time.Duration
-	value  string
+func NewRedisClient() *Redis {
+	return &Redis{client: NewRedisUniversalClient()}
 }
 
-func NewRedisClient() *Redis {
-	return &Redis{pool: NewRedisPool()}
+// NewRedisUniversalClient builds a goredis.UniversalClient according to the
+// "redis.mode" viper config, returning a *goredis.Client, *goredis.ClusterClient,
+// or a sentinel-backed failover client as appropriate.
+func NewRedisUniversalClient() goredis.UniversalClient {
+	mode := Mode(viper.GetString("redis.mode"))
+
+	var address = viper.GetString("redis.address")
+	var port = viper.GetString("redis.port")
+	var database = viper.GetInt("redis.database")
+	var password = viper.GetString("redis.password")
+
+	// normalize params
+	if address == "" {
+		address = "localhost"
+	}
+	if port == "" {
+		port = "6379"
+	}
+
+	addresses := viper.GetStringSlice("redis.addresses")
+	if len(addresses) == 0 {
+		addresses = []string{address + ":" + port}
+	}
+
+	return buildUniversalClient(universalClientConfig{
+		mode:       mode,
+		addresses:  addresses,
+		masterName: viper.GetString("redis.masterName"),
+		password:   password,
+		database:   database,
+	})
 }
 
-func (r *Redis) Del(collection string) error {
-	c := r.pool.Get()
-	defer utils.Close(c)
+// universalClientConfig is the common set of knobs needed to build a
+// goredis.UniversalClient, shared by NewRedisUniversalClient (viper-driven
+// singleton) and NewDataSource (explicit per-call config).
+type universalClientConfig struct {
+	mode       Mode
+	addresses  []string
+	masterName string
+	password   string
+	database   int
+	tlsConfig  *tls.Config
+}
+
+func buildUniversalClient(cfg universalClientConfig) goredis.UniversalClient {
+	switch cfg.mode {
+	case ModeCluster:
+		return goredis.NewClusterClient(&goredis.ClusterOptions{
+			Addrs:        cfg.addresses,
+			Password:     cfg.password,
+			TLSConfig:    cfg.tlsConfig,
+			DialTimeout:  time.Second * 10,
+			ReadTimeout:  time.Second * 600,
+			WriteTimeout: time.Second * 10,
+		})
+	case ModeSentinel:
+		return goredis.NewFailoverClient(&goredis.FailoverOptions{
+			MasterName:    cfg.masterName,
+			SentinelAddrs: cfg.addresses,
+			Password:      cfg.password,
+			DB:            cfg.database,
+			TLSConfig:     cfg.tlsConfig,
+			DialTimeout:   time.Second * 10,
+			ReadTimeout:   time.Second * 600,
+			WriteTimeout:  time.Second * 10,
+		})
+	default:
+		addr := "localhost:6379"
+		if len(cfg.addresses) > 0 {
+			addr = cfg.addresses[0]
+		}
+		return goredis.NewClient(&goredis.Options{
+			Addr:         addr,
+			Password:     cfg.password,
+			DB:           cfg.database,
+			TLSConfig:    cfg.tlsConfig,
+			DialTimeout:  time.Second * 10,
+			ReadTimeout:  time.Second * 600,
+			WriteTimeout: time.Second * 10,
+		})
+	}
+}
+
+func InitRedis() error {
+	RedisClient = NewRedisClient()
+	b := backoff.NewExponentialBackOff()
+	b.MaxInterval = 20 * time.Second
+	err := backoff.Retry(func() error {
+		err := RedisClient.PingCtx(context.Background())
 
-	if _, err := c.Do("DEL", collection); err != nil {
+		if err != nil {
+			log.WithError(err).Warnf("waiting for redis pool active connection. will after %f seconds try  again.", b.NextBackOff().Seconds())
+		}
+		return trace.TraceError(err)
+	}, b)
+	return trace.TraceError(err)
+}
+
+func (r *Redis) DelCtx(ctx context.Context, collection string) error {
+	if err := r.client.Del(ctx, collection).Err(); err != nil {
 		return trace.TraceError(err)
 	}
 	return nil
 }
 
-func (r *Redis) LLen(collection string) (int, error) {
-	c := r.pool.Get()
-	defer utils.Close(c)
+// Deprecated: use DelCtx instead. Retained during the redigo-to-go-redis
+// migration so existing callers keep compiling.
+func (r *Redis) Del(collection string) error {
+	return r.DelCtx(context.Background(), collection)
+}
 
-	value, err := redis.Int(c.Do("LLEN", collection))
+func (r *Redis) LLenCtx(ctx context.Context, collection string) (int, error) {
+	value, err := r.client.LLen(ctx, collection).Result()
 	if err != nil {
 		return 0, trace.TraceError(err)
 	}
-	return value, nil
+	return int(value), nil
 }
 
-func (r *Redis) RPush(collection string, value interface{}) error {
-	c := r.pool.Get()
-	defer utils.Close(c)
+// Deprecated: use LLenCtx instead.
+func (r *Redis) LLen(collection string) (int, error) {
+	return r.LLenCtx(context.Background(), collection)
+}
 
-	if _, err := c.Do("RPUSH", collection, value); err != nil {
+func (r *Redis) RPushCtx(ctx context.Context, collection string, value interface{}) error {
+	if err := r.client.RPush(ctx, collection, value).Err(); err != nil {
 		return trace.TraceError(err)
 	}
 	return nil
 }
 
-func (r *Redis) LPush(collection string, value interface{}) error {
-	c := r.pool.Get()
-	defer utils.Close(c)
+// Deprecated: use RPushCtx instead.
+func (r *Redis) RPush(collection string, value interface{}) error {
+	return r.RPushCtx(context.Background(), collection, value)
+}
 
-	if _, err := c.Do("RPUSH", collection, value); err != nil {
-		if err != redis.ErrNil {
+func (r *Redis) LPushCtx(ctx context.Context, collection string, value interface{}) error {
+	if err := r.client.RPush(ctx, collection, value).Err(); err != nil {
+		if err != goredis.Nil {
 			return trace.TraceError(err)
 		}
 		return err
@@ -84,13 +189,15 @@ func (r *Redis) LPush(collection string, value interface{}) error {
 	return nil
 }
 
-func (r *Redis) LPop(collection string) (string, error) {
-	c := r.pool.Get()
-	defer utils.Close(c)
+// Deprecated: use LPushCtx instead.
+func (r *Redis) LPush(collection string, value interface{}) error {
+	return r.LPushCtx(context.Background(), collection, value)
+}
 
-	value, err := redis.String(c.Do("LPOP", collection))
+func (r *Redis) LPopCtx(ctx context.Context, collection string) (string, error) {
+	value, err := r.client.LPop(ctx, collection).Result()
 	if err != nil {
-		if err != redis.ErrNil {
+		if err != goredis.Nil {
 			return value, trace.TraceError(err)
 		}
 		return value, err
@@ -98,12 +205,14 @@ func (r *Redis) LPop(collection string) (string, error) {
 	return value, nil
 }
 
-func (r *Redis) HSet(collection string, key string, value string) error {
-	c := r.pool.Get()
-	defer utils.Close(c)
+// Deprecated: use LPopCtx instead.
+func (r *Redis) LPop(collection string) (string, error) {
+	return r.LPopCtx(context.Background(), collection)
+}
 
-	if _, err := c.Do("HSET", collection, key, value); err != nil {
-		if err != redis.ErrNil {
+func (r *Redis) HSetCtx(ctx context.Context, collection string, key string, value string) error {
+	if err := r.client.HSet(ctx, collection, key, value).Err(); err != nil {
+		if err != goredis.Nil {
 			return trace.TraceError(err)
 		}
 		return err
@@ -111,24 +220,22 @@ func (r *Redis) HSet(collection string, key string, value string) error {
 	return nil
 }
 
-func (r *Redis) Ping() error {
-	c := r.pool.Get()
-	defer utils.Close(c)
-	if _, err := redis.String(c.Do("PING")); err != nil {
-		if err != redis.ErrNil {
-			return trace.TraceError(err)
-		}
-		return err
+// Deprecated: use HSetCtx instead.
+func (r *Redis) HSet(collection string, key string, value string) error {
+	return r.HSetCtx(context.Background(), collection, key, value)
+}
+
+func (r *Redis) SetCtx(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	if err := r.client.Set(ctx, key, value, ttl).Err(); err != nil {
+		return trace.TraceError(err)
 	}
 	return nil
 }
 
-func (r *Redis) HGet(collection string, key string) (string, error) {
-	c := r.pool.Get()
-	defer utils.Close(c)
-	value, err := redis.String(c.Do("HGET", collection, key))
-	if err != nil && err != redis.ErrNil {
-		if err != redis.ErrNil {
+func (r *Redis) GetCtx(ctx context.Context, key string) (string, error) {
+	value, err := r.client.Get(ctx, key).Result()
+	if err != nil {
+		if err != goredis.Nil {
 			return value, trace.TraceError(err)
 		}
 		return value, err
@@ -136,43 +243,69 @@ func (r *Redis) HGet(collection string, key string) (string, error) {
 	return value, nil
 }
 
-func (r *Redis) HDel(collection string, key string) error {
-	c := r.pool.Get()
-	defer utils.Close(c)
+// IncrCtx atomically increments key by 1 (creating it with value 1 if
+// absent) and returns its new value.
+func (r *Redis) IncrCtx(ctx context.Context, key string) (int64, error) {
+	value, err := r.client.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, trace.TraceError(err)
+	}
+	return value, nil
+}
+
+func (r *Redis) PingCtx(ctx context.Context) error {
+	if _, err := r.client.Ping(ctx).Result(); err != nil {
+		if err != goredis.Nil {
+			return trace.TraceError(err)
+		}
+		return err
+	}
+	return nil
+}
+
+// Deprecated: use PingCtx instead.
+func (r *Redis) Ping() error {
+	return r.PingCtx(context.Background())
+}
+
+func (r *Redis) HGetCtx(ctx context.Context, collection string, key string) (string, error) {
+	value, err := r.client.HGet(ctx, collection, key).Result()
+	if err != nil && err != goredis.Nil {
+		return value, trace.TraceError(err)
+	}
+	return value, nil
+}
+
+// Deprecated: use HGetCtx instead.
+func (r *Redis) HGet(collection string, key string) (string, error) {
+	return r.HGetCtx(context.Background(), collection, key)
+}
 
-	if _, err := c.Do("HDEL", collection, key); err != nil {
+func (r *Redis) HDelCtx(ctx context.Context, collection string, key string) error {
+	if err := r.client.HDel(ctx, collection, key).Err(); err != nil {
 		return trace.TraceError(err)
 	}
 	return nil
 }
 
-func (r *Redis) HScan(collection string) (results []string, err error) {
-	c := r.pool.Get()
-	defer utils.Close(c)
-	var (
-		cursor int64
-		items  []string
-	)
+// Deprecated: use HDelCtx instead.
+func (r *Redis) HDel(collection string, key string) error {
+	return r.HDelCtx(context.Background(), collection, key)
+}
 
+func (r *Redis) HScanCtx(ctx context.Context, collection string) (results []string, err error) {
+	var cursor uint64
 	for {
-		values, err := redis.Values(c.Do("HSCAN", collection, cursor))
-		if err != nil {
-			if err != redis.ErrNil {
-				return results, trace.TraceError(err)
-			}
-			return results, err
-		}
-
-		values, err = redis.Scan(values, &cursor, &items)
+		var items []string
+		items, cursor, err = r.client.HScan(ctx, collection, cursor, "", 0).Result()
 		if err != nil {
-			if err != redis.ErrNil {
+			if err != goredis.Nil {
 				return results, trace.TraceError(err)
 			}
 			return results, err
 		}
 		for i := 0; i < len(items); i += 2 {
-			cur := items[i+1]
-			results = append(results, cur)
+			results = append(results, items[i+1])
 		}
 		if cursor == 0 {
 			break
@@ -181,13 +314,15 @@ func (r *Redis) HScan(collection string) (results []string, err error) {
 	return results, nil
 }
 
-func (r *Redis) HKeys(collection string) (results []string, err error) {
-	c := r.pool.Get()
-	defer utils.Close(c)
+// Deprecated: use HScanCtx instead.
+func (r *Redis) HScan(collection string) (results []string, err error) {
+	return r.HScanCtx(context.Background(), collection)
+}
 
-	results, err = redis.Strings(c.Do("HKEYS", collection))
+func (r *Redis) HKeysCtx(ctx context.Context, collection string) (results []string, err error) {
+	results, err = r.client.HKeys(ctx, collection).Result()
 	if err != nil {
-		if err != redis.ErrNil {
+		if err != goredis.Nil {
 			return results, trace.TraceError(err)
 		}
 		return results, err
@@ -195,16 +330,18 @@ func (r *Redis) HKeys(collection string) (results []string, err error) {
 	return results, nil
 }
 
-func (r *Redis) BRPop(collection string, timeout int) (value string, err error) {
+// Deprecated: use HKeysCtx instead.
+func (r *Redis) HKeys(collection string) (results []string, err error) {
+	return r.HKeysCtx(context.Background(), collection)
+}
+
+func (r *Redis) BRPopCtx(ctx context.Context, collection string, timeout int) (value string, err error) {
 	if timeout <= 0 {
 		timeout = 60
 	}
-	c := r.pool.Get()
-	defer utils.Close(c)
-
-	values, err := redis.Strings(c.Do("BRPOP", collection, timeout))
+	values, err := r.client.BRPop(ctx, time.Duration(timeout)*time.Second, collection).Result()
 	if err != nil {
-		if err != redis.ErrNil {
+		if err != goredis.Nil {
 			return value, trace.TraceError(err)
 		}
 		return value, err
@@ -212,140 +349,98 @@ func (r *Redis) BRPop(collection string, timeout int) (value string, err error)
 	return values[1], nil
 }
 
-func NewRedisPool() *redis.Pool {
-	var address = viper.GetString("redis.address")
-	var port = viper.GetString("redis.port")
-	var database = viper.GetString("redis.database")
-	var password = viper.GetString("redis.password")
-
-	// normalize params
-	if address == "" {
-		address = "localhost"
-	}
-	if port == "" {
-		port = "6379"
-	}
-	if database == "" {
-		database = "1"
-	}
-
-	var url string
-	if password == "" {
-		url = "redis://" + address + ":" + port + "/" + database
-	} else {
-		url = "redis://x:" + password + "@" + address + ":" + port + "/" + database
-	}
-	return &redis.Pool{
-		Dial: func() (conn redis.Conn, e error) {
-			return redis.DialURL(url,
-				redis.DialConnectTimeout(time.Second*10),
-				redis.DialReadTimeout(time.Second*600),
-				redis.DialWriteTimeout(time.Second*10),
-			)
-		},
-		TestOnBorrow: func(c redis.Conn, t time.Time) error {
-			if time.Since(t) < time.Minute {
-				return nil
-			}
-			_, err := c.Do("PING")
-			return trace.TraceError(err)
-		},
-		MaxIdle:         10,
-		MaxActive:       0,
-		IdleTimeout:     300 * time.Second,
-		Wait:            false,
-		MaxConnLifetime: 0,
-	}
+// Deprecated: use BRPopCtx instead.
+func (r *Redis) BRPop(collection string, timeout int) (value string, err error) {
+	return r.BRPopCtx(context.Background(), collection, timeout)
 }
 
-func InitRedis() error {
-	RedisClient = NewRedisClient()
-	b := backoff.NewExponentialBackOff()
-	b.MaxInterval = 20 * time.Second
-	err := backoff.Retry(func() error {
-		err := RedisClient.Ping()
+// Pipeline wraps a goredis.Pipeliner so callers can batch several commands
+// (e.g. RPush, HSet) into a single round-trip via Exec.
+type Pipeline struct {
+	pipe goredis.Pipeliner
+}
 
-		if err != nil {
-			log.WithError(err).Warnf("waiting for redis pool active connection. will after %f seconds try  again.", b.NextBackOff().Seconds())
-		}
-		return trace.TraceError(err)
-	}, b)
-	return trace.TraceError(err)
+// Pipeline returns a new (non-transactional) pipeline. Queued commands are
+// only sent to Redis once Exec is called.
+func (r *Redis) Pipeline() *Pipeline {
+	return &Pipeline{pipe: r.client.Pipeline()}
 }
 
-// 构建同步锁key
-func (r *Redis) getLockKey(lockKey string) string {
-	lockKey = strings.ReplaceAll(lockKey, ":", "-")
-	return "nodes:lock:" + lockKey
+// TxPipeline returns a new pipeline whose queued commands execute atomically
+// inside a MULTI/EXEC transaction.
+func (r *Redis) TxPipeline() *Pipeline {
+	return &Pipeline{pipe: r.client.TxPipeline()}
 }
 
-// 获得锁
-func (r *Redis) Lock(lockKey string) (value int64, err error) {
-	c := r.pool.Get()
-	defer utils.Close(c)
-	lockKey = r.getLockKey(lockKey)
+func (p *Pipeline) RPush(collection string, value interface{}) {
+	p.pipe.RPush(context.Background(), collection, value)
+}
 
-	ts := time.Now().Unix()
-	ok, err := c.Do("SET", lockKey, ts, "NX", "PX", 30000)
-	if err != nil {
-		if err != redis.ErrNil {
-			return value, trace.TraceError(err)
-		}
-		return value, err
-	}
-	if ok == nil {
-		return 0, trace.TraceError(errors.ErrAlreadyLocked)
-	}
-	return ts, nil
+func (p *Pipeline) HSet(collection string, key string, value string) {
+	p.pipe.HSet(context.Background(), collection, key, value)
 }
 
-func (r *Redis) UnLock(lockKey string, value int64) {
-	c := r.pool.Get()
-	defer utils.Close(c)
-	lockKey = r.getLockKey(lockKey)
+func (p *Pipeline) Del(collection string) {
+	p.pipe.Del(context.Background(), collection)
+}
 
-	getValue, err := redis.Int64(c.Do("GET", lockKey))
-	if err != nil {
-		log.Errorf("get lockKey error: %s", err.Error())
-		return
+// Exec sends all queued commands to Redis in a single round-trip.
+func (p *Pipeline) Exec(ctx context.Context) error {
+	if _, err := p.pipe.Exec(ctx); err != nil {
+		return trace.TraceError(err)
 	}
+	return nil
+}
 
-	if getValue != value {
-		log.Errorf("the lockKey value diff: %d, %d", value, getValue)
-		return
-	}
+// Subscribe subscribes to the given channels, returning the underlying
+// PubSub alongside its message channel. ctx is only used for the initial
+// SUBSCRIBE command, not the lifetime of the subscription; callers must
+// call PubSub.Close when done to release the pooled connection it holds.
+func (r *Redis) Subscribe(ctx context.Context, channels ...string) (*goredis.PubSub, <-chan *goredis.Message) {
+	pubsub := r.client.Subscribe(ctx, channels...)
+	return pubsub, pubsub.Channel()
+}
 
-	v, err := redis.Int64(c.Do("DEL", lockKey))
-	if err != nil {
-		log.Errorf("unlock failed, error: %s", err.Error())
-		return
-	}
+// PSubscribe subscribes to the given channel patterns, returning the
+// underlying PubSub alongside its message channel. ctx is only used for
+// the initial PSUBSCRIBE command, not the lifetime of the subscription;
+// callers must call PubSub.Close when done to release the pooled
+// connection it holds.
+func (r *Redis) PSubscribe(ctx context.Context, patterns ...string) (*goredis.PubSub, <-chan *goredis.Message) {
+	pubsub := r.client.PSubscribe(ctx, patterns...)
+	return pubsub, pubsub.Channel()
+}
 
-	if v == 0 {
-		log.Errorf("unlock failed: key=%s", lockKey)
-		return
+// Publish publishes a message on the given channel.
+func (r *Redis) Publish(ctx context.Context, channel string, message interface{}) error {
+	if err := r.client.Publish(ctx, channel, message).Err(); err != nil {
+		return trace.TraceError(err)
 	}
+	return nil
 }
 
-func (r *Redis) MemoryStats() (stats map[string]int64, err error) {
+func (r *Redis) MemoryStatsCtx(ctx context.Context) (stats map[string]int64, err error) {
 	stats = map[string]int64{}
-	c := r.pool.Get()
-	defer utils.Close(c)
-	values, err := redis.Values(c.Do("MEMORY", "STATS"))
+	values, err := r.client.Do(ctx, "MEMORY", "STATS").Slice()
 	for i, v := range values {
-		t := reflect.TypeOf(v)
-		if t.Kind() == reflect.Slice {
-			vc, _ := redis.String(v, err)
-			if utils.ContainsString(MemoryStatsMetrics, vc) {
-				stats[vc], _ = redis.Int64(values[i+1], err)
+		vc, ok := v.(string)
+		if ok && utils.ContainsString(MemoryStatsMetrics, vc) {
+			switch n := values[i+1].(type) {
+			case int64:
+				stats[vc] = n
 			}
 		}
 	}
 	if err != nil {
-		if err != redis.ErrNil {
+		if err != goredis.Nil {
 			return stats, trace.TraceError(err)
 		}
 		return stats, err
 	}
 	return stats, nil
 }
+
+// Deprecated: use MemoryStatsCtx instead.
+func (r *Redis) MemoryStats() (stats map[string]int64, err error) {
+	return r.MemoryStatsCtx(context.Background())
+}